@@ -1,20 +1,18 @@
 package celbuxhelpers
 
 import (
-	"bytes"
 	cloudtasks "cloud.google.com/go/cloudtasks/apiv2"
 	"cloud.google.com/go/datastore"
 	"cloud.google.com/go/errorreporting"
 	"cloud.google.com/go/logging"
 	"cloud.google.com/go/storage"
+	"context"
 	b64 "encoding/base64"
 	"encoding/json"
 	"fmt"
 	"github.com/golang/gddo/httputil/header"
-	"golang.org/x/net/context"
 	"google.golang.org/appengine"
 	taskspb "google.golang.org/genproto/googleapis/cloud/tasks/v2"
-	ltype "google.golang.org/genproto/googleapis/logging/type"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"io/ioutil"
@@ -36,14 +34,15 @@ func GetProjectID() (string, error) {
 	return projectID, nil
 }
 
-func IntialiseClients(projectID string) error {
+func IntialiseClients(ctx context.Context, projectID string, kmsKeyName ...string) error {
 	//IntialiseClients provides all required GCP clients for use in main app engine code
+	// kmsKeyName is optional; if omitted it's read from the GOOGLE_CLOUD_KMS_KEY env var
 	// Initialise error to prevent shadowing
 	var err error
 
 	// Creates error client
 	if ErrorClient == nil {
-		ErrorClient, err = errorreporting.NewClient(context.Background(), projectID, errorreporting.Config{
+		ErrorClient, err = errorreporting.NewClient(ctx, projectID, errorreporting.Config{
 			ServiceName: projectID + "-service",
 			OnError: func(err error) {
 				log.Printf("Could not log error: %v", err)
@@ -56,7 +55,7 @@ func IntialiseClients(projectID string) error {
 
 	// Creates datastore client
 	if DatastoreClient == nil {
-		DatastoreClient, err = datastore.NewClient(context.Background(), projectID)
+		DatastoreClient, err = datastore.NewClient(ctx, projectID)
 		if err != nil {
 			return LogError(err)
 		}
@@ -64,15 +63,16 @@ func IntialiseClients(projectID string) error {
 
 	// Creates logging client
 	if LoggingClient == nil {
-		LoggingClient, err = logging.NewClient(context.Background(), projectID)
+		LoggingClient, err = logging.NewClient(ctx, projectID)
 		if err != nil {
 			return LogError(err)
 		}
+		SetCommonLabels(GAECommonLabels(projectID))
 	}
 
 	// Creates storage client
 	if StorageClient == nil {
-		StorageClient, err = storage.NewClient(context.Background())
+		StorageClient, err = storage.NewClient(ctx)
 		if err != nil {
 			return LogError(err)
 		}
@@ -80,12 +80,30 @@ func IntialiseClients(projectID string) error {
 
 	// Creates storage client
 	if TasksClient == nil {
-		TasksClient, err = cloudtasks.NewClient(context.Background())
+		TasksClient, err = cloudtasks.NewClient(ctx)
 		if err != nil {
 			return LogError(err)
 		}
 	}
 
+	// Creates KMS-backed encryption client. Opt-in: callers who don't use
+	// EncryptionClient don't need to supply a KMS key at all.
+	if KMSEncryptionClient == nil {
+		keyName := ""
+		if len(kmsKeyName) > 0 {
+			keyName = kmsKeyName[0]
+		} else {
+			keyName = os.Getenv("GOOGLE_CLOUD_KMS_KEY")
+		}
+
+		if keyName != "" {
+			KMSEncryptionClient, err = NewEncryptionClient(ctx, keyName)
+			if err != nil {
+				return LogError(err)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -120,26 +138,6 @@ func DecodeStruct(w http.ResponseWriter, r *http.Request, obj interface{}) error
 	return nil
 }
 
-func GLog(name string, text string, severity *ltype.LogSeverity) {
-	//severity is nillable. Debug by default
-	// Sets log name to unix nano second
-	logger := LoggingClient.Logger(name)
-
-	// Set severity based on params. Default Severity: DEBUG
-	var logSeverity logging.Severity
-	if severity == nil {
-		logSeverity = logging.Severity(ltype.LogSeverity_DEBUG)
-	} else {
-		logSeverity = logging.Severity(*severity)
-	}
-
-	// Adds an entry to the log buffer.
-	logger.Log(logging.Entry{
-		Payload: text,
-		Severity: logSeverity,
-	})
-}
-
 func LogError(err error) error {
 	// Log for Logs Viewer
 	ErrorClient.Report(errorreporting.Entry{
@@ -153,26 +151,30 @@ func LogError(err error) error {
 	return err
 }
 
-func DownloadObject(bucket string, object string) ([]byte, error) {
-	//DownloadObject downloads an object from Cloud Storage
-	rc, err := StorageClient.Bucket(bucket).Object(object).NewReader(context.Background())
-	if err != nil {
-		return nil, fmt.Errorf("Object(%q).NewReader: %v", object, err)
-	}
-	defer rc.Close()
+// QueueOption configures QueueHTTPRequest.
+type QueueOption func(*queueOptions)
 
-	data, err := ioutil.ReadAll(rc)
-	if err != nil {
-		return nil, fmt.Errorf("ioutil.ReadAll: %v", err)
-	}
+type queueOptions struct {
+	maxElapsedTime time.Duration
+}
 
-	return data, nil
+// WithQueueMaxElapsedTime caps how long QueueHTTPRequest retries CreateTask
+// before giving up. Zero means defaultMaxElapsedTime.
+func WithQueueMaxElapsedTime(d time.Duration) QueueOption {
+	return func(o *queueOptions) {
+		o.maxElapsedTime = d
+	}
 }
 
-func QueueHTTPRequest(projectID, locationID, queueID string, request *taskspb.HttpRequest) (*taskspb.Task, error) {
+func QueueHTTPRequest(ctx context.Context, projectID, locationID, queueID string, request *taskspb.HttpRequest, opts ...QueueOption) (*taskspb.Task, error) {
 	// createHTTPTask creates a new task with a HTTP target then adds it to a Queue.
 	// e.g. projects/bulk-writes/locations/europe-west1/queues/datastore-queue
 
+	var o queueOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	// Build the Task queue path.
 	queuePath := fmt.Sprintf("projects/%s/locations/%s/queues/%s", projectID, locationID, queueID)
 
@@ -188,7 +190,12 @@ func QueueHTTPRequest(projectID, locationID, queueID string, request *taskspb.Ht
 		},
 	}
 
-	createdTask, err := TasksClient.CreateTask(context.Background(), req)
+	var createdTask *taskspb.Task
+	err := runWithRetry(ctx, retryConfig{MaxElapsedTime: o.maxElapsedTime}, func() error {
+		var err error
+		createdTask, err = TasksClient.CreateTask(ctx, req)
+		return err
+	})
 	if err != nil {
 		return nil, LogError(err)
 	}
@@ -196,84 +203,6 @@ func QueueHTTPRequest(projectID, locationID, queueID string, request *taskspb.Ht
 	return createdTask, nil
 }
 
-type QueueServiceRequest struct {
-	// Used both for receiving data here, and sending to queue service
-	Kind string
-	Entities []interface{}
-}
-
-func WriteToDatastore(request QueueServiceRequest) error {
-	// Properly splits up entities into 31MB chunks to be sent to queue-service coordinate writes
-	// App Engine HTTP PUT limit is 32MB
-	queueServiceRequest := QueueServiceRequest{
-		Kind: request.Kind,
-		Entities: nil,
-	}
-
-	var inOperation bool
-	var bits int
-	for _, entity := range request.Entities {
-		// Set to true when operating
-		inOperation = true
-
-		// Get megabytes
-		bits += len(entity.([]byte))
-		megabytes := bits / 8000000
-
-		// If data is over 31 megabytes, send HTTP request, else just add entity to slice
-		if megabytes >= 31 {
-			err := sendRequest(queueServiceRequest)
-			if err != nil {
-				return LogError(err)
-			}
-
-			inOperation = false
-			queueServiceRequest.Entities = nil
-		} else {
-			queueServiceRequest.Entities = append(queueServiceRequest.Entities, entity)
-		}
-	}
-
-	// Makes sure to write last data if for loop exited while still in operation
-	if inOperation {
-		err := sendRequest(queueServiceRequest)
-		if err != nil {
-			return LogError(err)
-		}
-
-		inOperation = false
-	}
-
-	return nil
-}
-
-func sendRequest(data QueueServiceRequest) error {
-	client := &http.Client{}
-	projectID, err := GetProjectID()
-	if err != nil {
-		return LogError(err)
-	}
-
-	var dataJSON []byte
-	dataJSON, err = json.Marshal(data)
-	if err != nil {
-		return LogError(err)
-	}
-
-	var req *http.Request
-	req, err = http.NewRequest(http.MethodPut, fmt.Sprintf("queue-service-dot-%v.ew.r.appspot.com/start_work?opsPerInstance=1&entitiesPerRequest=500", projectID), bytes.NewBuffer(dataJSON))
-	if err != nil {
-		return LogError(err)
-	}
-
-	_, err = client.Do(req)
-	if err != nil {
-		return LogError(err)
-	}
-
-	return nil
-}
-
 func PrintHTTPBody(resp *http.Response) (string, error) {
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -282,11 +211,11 @@ func PrintHTTPBody(resp *http.Response) (string, error) {
 	return string(body), nil
 }
 
-func Encrypt(data string) string {
+func EncodeBase64URL(data string) string {
 	return b64.URLEncoding.EncodeToString([]byte(data))
 }
 
-func Decrypt(data string) (string, error) {
+func DecodeBase64URL(data string) (string, error) {
 	s, err := b64.URLEncoding.DecodeString(data)
 	if err != nil {
 		return "", err
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	helpers "github.com/MSpaceDev/CelbuxHelpers"
 )
@@ -35,7 +36,7 @@ type UserInfo struct {
 }
 
 func main() {
-	err := helpers.IntialiseClients("jiraonthego")
+	err := helpers.IntialiseClients(context.Background(), "jiraonthego")
 	if err != nil {
 		_ = helpers.LogError(err)
 	    return
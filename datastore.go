@@ -0,0 +1,313 @@
+package celbuxhelpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/idtoken"
+	taskspb "google.golang.org/genproto/googleapis/cloud/tasks/v2"
+)
+
+const (
+	// maxEntitiesPerCommit is Datastore's hard limit on mutations allowed in
+	// a single commit/transaction.
+	maxEntitiesPerCommit = 500
+
+	// defaultMaxBatchBytes further bounds a batch's estimated serialized
+	// size, independent of maxEntitiesPerCommit, to stay well clear of
+	// Datastore's per-request payload limit.
+	defaultMaxBatchBytes = 9 * 1024 * 1024
+)
+
+// BatchOption configures BatchWriteDatastore.
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	maxBatchBytes int
+
+	fanOut         bool
+	queueID        string
+	handlerURL     string
+	serviceAccount string
+
+	maxElapsedTime time.Duration
+}
+
+// WithMaxBatchBytes overrides the estimated-size budget used, alongside
+// Datastore's 500-entity commit limit, to split entities into batches.
+func WithMaxBatchBytes(n int) BatchOption {
+	return func(o *batchOptions) {
+		o.maxBatchBytes = n
+	}
+}
+
+// WithFanOutViaTasks routes each batch through Cloud Tasks instead of
+// committing it directly: one HTTP task per batch is enqueued onto queueID,
+// targeting handlerURL (handled by RegisterBatchHandler) with an OIDC token
+// minted for serviceAccountEmail.
+func WithFanOutViaTasks(queueID, handlerURL, serviceAccountEmail string) BatchOption {
+	return func(o *batchOptions) {
+		o.fanOut = true
+		o.queueID = queueID
+		o.handlerURL = handlerURL
+		o.serviceAccount = serviceAccountEmail
+	}
+}
+
+// WithMaxElapsedTime caps how long BatchWriteDatastore retries a single
+// batch (commit or enqueue) before giving up on it. Zero means
+// defaultMaxElapsedTime.
+func WithMaxElapsedTime(d time.Duration) BatchOption {
+	return func(o *batchOptions) {
+		o.maxElapsedTime = d
+	}
+}
+
+// BatchWriteResult summarises the outcome of a BatchWriteDatastore call.
+type BatchWriteResult struct {
+	// Committed is the number of entities successfully committed (or
+	// successfully enqueued, under WithFanOutViaTasks).
+	Committed int
+	// FailedBatches holds the zero-based index of every batch that could
+	// not be committed/enqueued, in the order batches were built.
+	FailedBatches []int
+	// Retries is the total number of retry attempts spent across all
+	// batches.
+	Retries int
+}
+
+// BatchWriteDatastore writes entities of the given kind to Datastore,
+// splitting them into batches that respect both Datastore's 500-entity
+// commit limit and a payload-byte budget. By default each batch is
+// committed directly inside a retried transaction; WithFanOutViaTasks
+// enqueues it as a Cloud Tasks HTTP task instead, so large writes can be
+// fanned out across App Engine instances rather than blocking the caller.
+func BatchWriteDatastore(ctx context.Context, kind string, entities []datastore.PropertyList, opts ...BatchOption) (BatchWriteResult, error) {
+	o := batchOptions{maxBatchBytes: defaultMaxBatchBytes}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	batches := splitIntoBatches(entities, o.maxBatchBytes)
+
+	var result BatchWriteResult
+	var firstErr error
+	for i, batch := range batches {
+		attempts := 0
+		err := runWithRetry(ctx, retryConfig{MaxElapsedTime: o.maxElapsedTime}, func() error {
+			attempts++
+			if o.fanOut {
+				return enqueueBatch(ctx, kind, batch, o)
+			}
+			return commitBatch(ctx, kind, batch)
+		})
+		if attempts > 1 {
+			result.Retries += attempts - 1
+		}
+		if err != nil {
+			result.FailedBatches = append(result.FailedBatches, i)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		result.Committed += len(batch)
+	}
+
+	if firstErr != nil {
+		return result, LogError(fmt.Errorf("BatchWriteDatastore: %d/%d batches failed, first error: %v", len(result.FailedBatches), len(batches), firstErr))
+	}
+	return result, nil
+}
+
+// splitIntoBatches groups entities into slices no larger than
+// maxEntitiesPerCommit and whose estimated serialized size stays under
+// maxBytes.
+func splitIntoBatches(entities []datastore.PropertyList, maxBytes int) [][]datastore.PropertyList {
+	var batches [][]datastore.PropertyList
+	var current []datastore.PropertyList
+	var currentBytes int
+
+	for _, entity := range entities {
+		size := estimatePropertyListSize(entity)
+
+		if len(current) > 0 && (len(current) >= maxEntitiesPerCommit || currentBytes+size > maxBytes) {
+			batches = append(batches, current)
+			current = nil
+			currentBytes = 0
+		}
+
+		current = append(current, entity)
+		currentBytes += size
+	}
+
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+
+	return batches
+}
+
+// estimatePropertyListSize approximates the serialized size of a Datastore
+// entity. The SDK doesn't expose a public helper for this (saveEntity and
+// its proto conversions are internal), so this walks the exported Property
+// values instead; it adds no allowance for encoding overhead, so it is an
+// approximation, not an exact wire size.
+func estimatePropertyListSize(props datastore.PropertyList) int {
+	size := 0
+	for _, p := range props {
+		size += len(p.Name)
+		size += estimatePropertyValueSize(p.Value)
+	}
+	return size
+}
+
+func estimatePropertyValueSize(v interface{}) int {
+	const scalarSize = 8
+
+	switch val := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(val)
+	case []byte:
+		return len(val)
+	case int64, float64, bool, time.Time, datastore.GeoPoint:
+		return scalarSize
+	case *datastore.Key:
+		if val == nil {
+			return 0
+		}
+		return len(val.Kind) + len(val.Name) + scalarSize
+	case *datastore.Entity:
+		if val == nil {
+			return 0
+		}
+		return estimatePropertyListSize(val.Properties)
+	case []interface{}:
+		size := 0
+		for _, elem := range val {
+			size += estimatePropertyValueSize(elem)
+		}
+		return size
+	default:
+		return scalarSize
+	}
+}
+
+// commitBatch writes one batch of entities directly, inside a transaction,
+// via PutMulti.
+func commitBatch(ctx context.Context, kind string, batch []datastore.PropertyList) error {
+	keys := make([]*datastore.Key, len(batch))
+	for i := range batch {
+		keys[i] = datastore.IncompleteKey(kind, nil)
+	}
+
+	_, err := DatastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		_, err := tx.PutMulti(keys, batch)
+		return err
+	})
+	return err
+}
+
+// batchTaskPayload is the gob-encoded body of each fan-out Cloud Tasks
+// request; RegisterBatchHandler decodes it back on the receiving end.
+type batchTaskPayload struct {
+	Kind     string
+	Entities []datastore.PropertyList
+}
+
+func init() {
+	// datastore.Property.Value is an interface{} that may hold any of these
+	// concrete types (see datastore.Property's doc comment); gob requires
+	// each one registered up front or Encode fails the first time a batch
+	// contains one, e.g. a timestamp property.
+	gob.Register(time.Time{})
+	gob.Register(datastore.GeoPoint{})
+	gob.Register(&datastore.Key{})
+	gob.Register(&datastore.Entity{})
+	gob.Register([]interface{}{})
+}
+
+// enqueueBatch gob-encodes batch and enqueues it as an OIDC-authenticated
+// HTTP task targeting o.handlerURL.
+func enqueueBatch(ctx context.Context, kind string, batch []datastore.PropertyList, o batchOptions) error {
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(batchTaskPayload{Kind: kind, Entities: batch}); err != nil {
+		return fmt.Errorf("gob.Encode: %v", err)
+	}
+
+	projectID, err := GetProjectID()
+	if err != nil {
+		return err
+	}
+
+	req := &taskspb.HttpRequest{
+		Url:        o.handlerURL,
+		HttpMethod: taskspb.HttpMethod_POST,
+		Body:       body.Bytes(),
+		AuthorizationHeader: &taskspb.HttpRequest_OidcToken{
+			OidcToken: &taskspb.OidcToken{
+				ServiceAccountEmail: o.serviceAccount,
+				Audience:            o.handlerURL,
+			},
+		},
+	}
+
+	_, err = QueueHTTPRequest(ctx, projectID, os.Getenv("GOOGLE_CLOUD_LOCATION"), o.queueID, req, WithQueueMaxElapsedTime(o.maxElapsedTime))
+	return err
+}
+
+// RegisterBatchHandler registers an http.HandlerFunc at path on mux that
+// decodes the gob-encoded payload enqueued by BatchWriteDatastore's
+// WithFanOutViaTasks, verifies the request's OIDC token, and invokes
+// handler with the batch's kind and entities. handlerURL must be the exact
+// same URL passed to WithFanOutViaTasks, since that's the audience the OIDC
+// token was minted for.
+func RegisterBatchHandler(mux *http.ServeMux, path, handlerURL string, handler func(ctx context.Context, kind string, entities []datastore.PropertyList) error) {
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if err := verifyOIDCToken(ctx, r, handlerURL); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var payload batchTaskPayload
+		if err := gob.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, fmt.Sprintf("decode batch payload: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := handler(ctx, payload.Kind, payload.Entities); err != nil {
+			LogError(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// verifyOIDCToken validates the bearer token Cloud Tasks attaches to
+// fan-out requests against audience, which must be the same handlerURL the
+// task was created with in enqueueBatch (the value minted into the token's
+// aud claim) rather than anything re-derived from the inbound request.
+func verifyOIDCToken(ctx context.Context, r *http.Request, audience string) error {
+	authHeader := r.Header.Get("Authorization")
+	const bearerPrefix = "Bearer "
+	if len(authHeader) <= len(bearerPrefix) || authHeader[:len(bearerPrefix)] != bearerPrefix {
+		return fmt.Errorf("missing bearer token")
+	}
+
+	if _, err := idtoken.Validate(ctx, authHeader[len(bearerPrefix):], audience); err != nil {
+		return fmt.Errorf("validate OIDC token: %v", err)
+	}
+	return nil
+}
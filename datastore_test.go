@@ -0,0 +1,115 @@
+package celbuxhelpers
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+func propsOfSize(n int) datastore.PropertyList {
+	return datastore.PropertyList{
+		{Name: "payload", Value: make([]byte, n)},
+	}
+}
+
+func TestSplitIntoBatchesEntityLimit(t *testing.T) {
+	entities := make([]datastore.PropertyList, maxEntitiesPerCommit+1)
+	for i := range entities {
+		entities[i] = propsOfSize(1)
+	}
+
+	batches := splitIntoBatches(entities, defaultMaxBatchBytes)
+	if len(batches) != 2 {
+		t.Fatalf("got %d batches, want 2", len(batches))
+	}
+	if len(batches[0]) != maxEntitiesPerCommit {
+		t.Errorf("first batch has %d entities, want exactly %d", len(batches[0]), maxEntitiesPerCommit)
+	}
+	if len(batches[1]) != 1 {
+		t.Errorf("second batch has %d entities, want 1", len(batches[1]))
+	}
+}
+
+func TestSplitIntoBatchesExactlyAtEntityLimit(t *testing.T) {
+	entities := make([]datastore.PropertyList, maxEntitiesPerCommit)
+	for i := range entities {
+		entities[i] = propsOfSize(1)
+	}
+
+	batches := splitIntoBatches(entities, defaultMaxBatchBytes)
+	if len(batches) != 1 {
+		t.Fatalf("got %d batches, want 1", len(batches))
+	}
+	if len(batches[0]) != maxEntitiesPerCommit {
+		t.Errorf("batch has %d entities, want %d", len(batches[0]), maxEntitiesPerCommit)
+	}
+}
+
+func TestSplitIntoBatchesByteBudget(t *testing.T) {
+	// Each entity is ~100 bytes; a 250-byte budget should fit 2 per batch.
+	entities := []datastore.PropertyList{
+		propsOfSize(100), propsOfSize(100), propsOfSize(100), propsOfSize(100), propsOfSize(100),
+	}
+
+	batches := splitIntoBatches(entities, 250)
+	if len(batches) != 3 {
+		t.Fatalf("got %d batches, want 3; batches: %v", len(batches), batches)
+	}
+	for i, b := range batches[:2] {
+		if len(b) != 2 {
+			t.Errorf("batch %d has %d entities, want 2", i, len(b))
+		}
+	}
+	if len(batches[2]) != 1 {
+		t.Errorf("last batch has %d entities, want 1", len(batches[2]))
+	}
+}
+
+func TestSplitIntoBatchesSingleOversizedEntity(t *testing.T) {
+	// A single entity larger than the byte budget must still get its own
+	// batch rather than being dropped or blocking forever.
+	entities := []datastore.PropertyList{propsOfSize(1000), propsOfSize(10)}
+
+	batches := splitIntoBatches(entities, 100)
+	if len(batches) != 2 {
+		t.Fatalf("got %d batches, want 2; batches: %v", len(batches), batches)
+	}
+	if len(batches[0]) != 1 {
+		t.Errorf("first batch has %d entities, want 1", len(batches[0]))
+	}
+}
+
+func TestSplitIntoBatchesEmpty(t *testing.T) {
+	if batches := splitIntoBatches(nil, defaultMaxBatchBytes); batches != nil {
+		t.Errorf("got %v, want nil for no entities", batches)
+	}
+}
+
+func TestEstimatePropertyValueSize(t *testing.T) {
+	key := &datastore.Key{Kind: "Foo", Name: "bar"}
+
+	cases := []struct {
+		name string
+		v    interface{}
+		want int
+	}{
+		{"nil", nil, 0},
+		{"string", "hello", 5},
+		{"bytes", []byte{1, 2, 3}, 3},
+		{"int64", int64(42), 8},
+		{"time", time.Now(), 8},
+		{"geopoint", datastore.GeoPoint{Lat: 1, Lng: 2}, 8},
+		{"nil key", (*datastore.Key)(nil), 0},
+		{"key", key, len(key.Kind) + len(key.Name) + 8},
+		{"slice", []interface{}{"ab", int64(1)}, 2 + 8},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := estimatePropertyValueSize(c.v); got != c.want {
+				t.Errorf("estimatePropertyValueSize(%v) = %d, want %d", c.v, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package celbuxhelpers
+
+import (
+	"sync"
+	"time"
+)
+
+// Deadline tracks independent read and write deadlines for an operation that
+// doesn't natively accept a context.Context, closing a cancellation channel
+// once the relevant deadline elapses. Modeled on the deadlineTimer used by
+// gVisor's netstack/gonet package.
+type Deadline struct {
+	mu sync.Mutex
+
+	readCancelCh chan struct{}
+	readTimer    *time.Timer
+
+	writeCancelCh chan struct{}
+	writeTimer    *time.Timer
+}
+
+// NewDeadline returns a Deadline with no read or write deadline set.
+func NewDeadline() *Deadline {
+	return &Deadline{
+		readCancelCh:  make(chan struct{}),
+		writeCancelCh: make(chan struct{}),
+	}
+}
+
+// ReadCancel returns the channel that is closed once the read deadline
+// elapses. Callers select on it alongside the operation they want to bound.
+func (d *Deadline) ReadCancel() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.readCancelCh
+}
+
+// WriteCancel returns the channel that is closed once the write deadline
+// elapses. Callers select on it alongside the operation they want to bound.
+func (d *Deadline) WriteCancel() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.writeCancelCh
+}
+
+// SetReadDeadline sets the time after which ReadCancel's channel closes.
+// A zero Time clears the deadline without closing the channel.
+func (d *Deadline) SetReadDeadline(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	setDeadline(&d.readCancelCh, &d.readTimer, t)
+}
+
+// SetWriteDeadline sets the time after which WriteCancel's channel closes.
+// A zero Time clears the deadline without closing the channel.
+func (d *Deadline) SetWriteDeadline(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	setDeadline(&d.writeCancelCh, &d.writeTimer, t)
+}
+
+// setDeadline contains the shared logic for setting a deadline. It must only
+// be called while the owning Deadline's mu is held.
+func setDeadline(cancelCh *chan struct{}, timer **time.Timer, t time.Time) {
+	if *timer != nil && !(*timer).Stop() {
+		// The timer already fired and closed the previous channel; install a
+		// fresh one so a new deadline can be waited on.
+		*cancelCh = make(chan struct{})
+	}
+
+	// The previous channel may already be closed without *timer having fired
+	// an AfterFunc at all, e.g. a prior call that set an already-past
+	// deadline closed it directly below. Replace it so the close() below
+	// never double-closes.
+	select {
+	case <-*cancelCh:
+		*cancelCh = make(chan struct{})
+	default:
+	}
+
+	if t.IsZero() {
+		return
+	}
+
+	timeout := time.Until(t)
+	if timeout <= 0 {
+		close(*cancelCh)
+		return
+	}
+
+	ch := *cancelCh
+	*timer = time.AfterFunc(timeout, func() {
+		close(ch)
+	})
+}
@@ -0,0 +1,54 @@
+package celbuxhelpers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadlineRepeatedExpiredSetDoesNotPanic(t *testing.T) {
+	d := NewDeadline()
+
+	d.SetReadDeadline(time.Now().Add(-time.Hour))
+	select {
+	case <-d.ReadCancel():
+	default:
+		t.Fatal("ReadCancel should be closed after an already-past deadline")
+	}
+
+	// Must not panic with "close of closed channel".
+	d.SetReadDeadline(time.Now().Add(-time.Hour))
+	select {
+	case <-d.ReadCancel():
+	default:
+		t.Fatal("ReadCancel should still be closed after a second expired deadline")
+	}
+}
+
+func TestDeadlineSetWriteDeadlineFires(t *testing.T) {
+	d := NewDeadline()
+	d.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+
+	select {
+	case <-d.WriteCancel():
+		t.Fatal("WriteCancel closed before the deadline elapsed")
+	default:
+	}
+
+	select {
+	case <-d.WriteCancel():
+	case <-time.After(time.Second):
+		t.Fatal("WriteCancel was not closed after the deadline elapsed")
+	}
+}
+
+func TestDeadlineZeroClears(t *testing.T) {
+	d := NewDeadline()
+	d.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	d.SetReadDeadline(time.Time{})
+
+	select {
+	case <-d.ReadCancel():
+		t.Fatal("ReadCancel closed despite the deadline being cleared")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,187 @@
+package celbuxhelpers
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+const (
+	// encryptionVersion identifies the on-disk layout of ciphertext produced
+	// by EncryptionClient.Encrypt so it can evolve without breaking values
+	// written under an older layout.
+	encryptionVersion byte = 1
+
+	// dekSizeBytes is the size of each AES-256 data encryption key that
+	// EncryptionClient generates (a fresh one every time the cached DEK
+	// expires).
+	dekSizeBytes = 32
+
+	// defaultDEKTTL is how long a cached DEK is reused before a fresh one is
+	// generated and wrapped via KMS.
+	defaultDEKTTL = time.Hour
+)
+
+// EncryptionClient performs envelope encryption: plaintext is sealed with a
+// locally-held AES-256-GCM data encryption key (DEK), and the DEK itself is
+// wrapped by a Cloud KMS key so the plaintext DEK never leaves the process.
+// The wrapped DEK travels alongside each ciphertext, so the KMS key can be
+// rotated without invalidating values encrypted under an older key version.
+type EncryptionClient struct {
+	mu sync.Mutex
+
+	kmsClient *kms.KeyManagementClient
+	keyName   string
+	dekTTL    time.Duration
+
+	dek        []byte
+	wrappedDEK []byte
+	dekExpiry  time.Time
+}
+
+// NewEncryptionClient dials Cloud KMS and returns an EncryptionClient that
+// wraps its data encryption keys with keyName, e.g.
+// "projects/p/locations/global/keyRings/r/cryptoKeys/k".
+func NewEncryptionClient(ctx context.Context, keyName string) (*EncryptionClient, error) {
+	kmsClient, err := kms.NewKeyManagementClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptionClient{
+		kmsClient: kmsClient,
+		keyName:   keyName,
+		dekTTL:    defaultDEKTTL,
+	}, nil
+}
+
+// SetDEKTTL overrides the default lifetime a DEK is cached in memory before
+// EncryptionClient generates and wraps a replacement.
+func (e *EncryptionClient) SetDEKTTL(ttl time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dekTTL = ttl
+}
+
+// currentDEK returns the cached plaintext DEK and its KMS-wrapped form,
+// generating and wrapping a new one if the cached DEK is missing or expired.
+func (e *EncryptionClient) currentDEK(ctx context.Context) (dek, wrappedDEK []byte, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.dek != nil && time.Now().Before(e.dekExpiry) {
+		return e.dek, e.wrappedDEK, nil
+	}
+
+	dek = make([]byte, dekSizeBytes)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, nil, fmt.Errorf("generate DEK: %v", err)
+	}
+
+	resp, err := e.kmsClient.Encrypt(ctx, &kmspb.EncryptRequest{
+		Name:      e.keyName,
+		Plaintext: dek,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("kms Encrypt: %v", err)
+	}
+
+	e.dek = dek
+	e.wrappedDEK = resp.Ciphertext
+	e.dekExpiry = time.Now().Add(e.dekTTL)
+
+	return e.dek, e.wrappedDEK, nil
+}
+
+// Encrypt seals plaintext with AES-256-GCM under the current DEK and
+// prepends a version byte, the KMS-wrapped DEK, and the GCM nonce so
+// Decrypt can unwrap the correct DEK version and authenticate the result.
+func (e *EncryptionClient) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	dek, wrappedDEK, err := e.currentDEK(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %v", err)
+	}
+
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+
+	out := make([]byte, 0, 1+2+len(wrappedDEK)+len(nonce)+len(ciphertext))
+	out = append(out, encryptionVersion)
+	out = append(out, byte(len(wrappedDEK)>>8), byte(len(wrappedDEK)))
+	out = append(out, wrappedDEK...)
+	out = append(out, nonce...)
+	out = append(out, ciphertext...)
+
+	return out, nil
+}
+
+// Decrypt reverses Encrypt: it unwraps the DEK embedded in ciphertext via
+// KMS (so it works regardless of which key version produced it) and opens
+// the AES-256-GCM payload.
+func (e *EncryptionClient) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 3 {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	if version := ciphertext[0]; version != encryptionVersion {
+		return nil, fmt.Errorf("unsupported encryption version %d", version)
+	}
+
+	wrappedLen := int(ciphertext[1])<<8 | int(ciphertext[2])
+	offset := 3
+	if len(ciphertext) < offset+wrappedLen {
+		return nil, fmt.Errorf("ciphertext truncated: missing wrapped DEK")
+	}
+	wrappedDEK := ciphertext[offset : offset+wrappedLen]
+	offset += wrappedLen
+
+	resp, err := e.kmsClient.Decrypt(ctx, &kmspb.DecryptRequest{
+		Name:       e.keyName,
+		Ciphertext: wrappedDEK,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kms Decrypt: %v", err)
+	}
+
+	gcm, err := newGCM(resp.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(ciphertext) < offset+nonceSize {
+		return nil, fmt.Errorf("ciphertext truncated: missing nonce")
+	}
+	nonce := ciphertext[offset : offset+nonceSize]
+	offset += nonceSize
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext[offset:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("gcm Open: %v", err)
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes.NewCipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,166 @@
+package celbuxhelpers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	ltype "google.golang.org/genproto/googleapis/logging/type"
+)
+
+const (
+	// logBatchSize and logBatchDelay bound how long an entry can sit in a
+	// Logger's buffer before FlushLogs is called explicitly, e.g. on
+	// process exit.
+	logBatchSize  = 100
+	logBatchDelay = 2 * time.Second
+)
+
+var (
+	loggerMu     sync.Mutex
+	loggers      = map[string]*logging.Logger{}
+	commonLabels map[string]string
+)
+
+// SetCommonLabels attaches labels (typically project, service, version, and
+// instance) to every Logger created afterwards, so entries from this process
+// can be correlated in Cloud Logging. Call it once during start up, before
+// the first GLog/GLogRequest call for a given log name.
+func SetCommonLabels(labels map[string]string) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	commonLabels = labels
+}
+
+// GAECommonLabels builds CommonLabels from the App Engine standard
+// environment (GAE_SERVICE, GAE_VERSION, GAE_INSTANCE), which App Engine
+// sets automatically; it's a convenience for SetCommonLabels.
+func GAECommonLabels(projectID string) map[string]string {
+	return map[string]string{
+		"project":  projectID,
+		"service":  os.Getenv("GAE_SERVICE"),
+		"version":  os.Getenv("GAE_VERSION"),
+		"instance": os.Getenv("GAE_INSTANCE"),
+	}
+}
+
+// logger returns the cached *logging.Logger for name, creating and caching
+// one on first use so repeated GLog calls reuse the same batching buffer.
+func logger(name string) *logging.Logger {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+
+	if l, ok := loggers[name]; ok {
+		return l
+	}
+
+	opts := []logging.LoggerOption{
+		logging.EntryCountThreshold(logBatchSize),
+		logging.DelayThreshold(logBatchDelay),
+	}
+	if len(commonLabels) > 0 {
+		opts = append(opts, logging.CommonLabels(commonLabels))
+	}
+
+	l := LoggingClient.Logger(name, opts...)
+	loggers[name] = l
+	return l
+}
+
+// LogEntry is the structured payload accepted by GLog. Payload lands as
+// jsonPayload in Cloud Logging unless it's a string, in which case it lands
+// as textPayload.
+type LogEntry struct {
+	Payload     interface{}
+	Severity    *ltype.LogSeverity
+	Labels      map[string]string
+	HTTPRequest *logging.HTTPRequest
+	TraceID     string
+	SpanID      string
+}
+
+// GLog adds entry to the batched Logger cached under name. Severity is
+// nillable; DEBUG is used by default. ctx is accepted for cancellation
+// parity with the other helpers; the underlying Logger buffers and flushes
+// asynchronously regardless.
+func GLog(ctx context.Context, name string, entry LogEntry) {
+	logSeverity := logging.Severity(ltype.LogSeverity_DEBUG)
+	if entry.Severity != nil {
+		logSeverity = logging.Severity(*entry.Severity)
+	}
+
+	logger(name).Log(logging.Entry{
+		Payload:     entry.Payload,
+		Severity:    logSeverity,
+		Labels:      entry.Labels,
+		HTTPRequest: entry.HTTPRequest,
+		Trace:       entry.TraceID,
+		SpanID:      entry.SpanID,
+	})
+}
+
+// GLogRequest logs payload under name for the incoming HTTP request r,
+// extracting X-Cloud-Trace-Context so the entry groups under the request's
+// parent trace in Cloud Logging.
+func GLogRequest(ctx context.Context, name string, r *http.Request, severity *ltype.LogSeverity, payload interface{}) {
+	traceID, spanID := traceContext(r)
+
+	GLog(ctx, name, LogEntry{
+		Payload:     payload,
+		Severity:    severity,
+		TraceID:     traceID,
+		SpanID:      spanID,
+		HTTPRequest: &logging.HTTPRequest{Request: r},
+	})
+}
+
+// traceContext parses the X-Cloud-Trace-Context header
+// ("TRACE_ID/SPAN_ID;o=OPTIONS") into the full trace resource name and
+// 16-character hex span ID Cloud Logging expects.
+func traceContext(r *http.Request) (traceID, spanID string) {
+	header := r.Header.Get("X-Cloud-Trace-Context")
+	if header == "" {
+		return "", ""
+	}
+
+	parts := strings.SplitN(header, "/", 2)
+	rawTraceID := parts[0]
+	if rawTraceID == "" {
+		return "", ""
+	}
+
+	if len(parts) > 1 {
+		rawSpanID := strings.SplitN(parts[1], ";", 2)[0]
+		if spanInt, err := strconv.ParseUint(rawSpanID, 10, 64); err == nil {
+			spanID = fmt.Sprintf("%016x", spanInt)
+		}
+	}
+
+	projectID, err := GetProjectID()
+	if err != nil {
+		return rawTraceID, spanID
+	}
+
+	return fmt.Sprintf("projects/%s/traces/%s", projectID, rawTraceID), spanID
+}
+
+// FlushLogs flushes every cached Logger's buffered entries. Call it from a
+// defer in main so entries aren't lost on process exit.
+func FlushLogs() error {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+
+	var firstErr error
+	for _, l := range loggers {
+		if err := l.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
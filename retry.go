@@ -0,0 +1,85 @@
+package celbuxhelpers
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultMaxElapsedTime = 2 * time.Minute
+	initialBackoff        = 100 * time.Millisecond
+	maxBackoff            = 10 * time.Second
+	backoffMultiplier     = 2
+)
+
+// retryConfig controls runWithRetry's backoff behaviour. The zero value uses
+// sane defaults.
+type retryConfig struct {
+	// MaxElapsedTime bounds the total time spent retrying before giving up
+	// and returning the last error. Zero means defaultMaxElapsedTime.
+	MaxElapsedTime time.Duration
+}
+
+// runWithRetry calls fn until it returns nil, a non-retryable error, ctx is
+// done, or cfg.MaxElapsedTime elapses, backing off exponentially with jitter
+// between attempts. Modeled on the run(ctx, call, retry, isIdempotent,
+// setRetryHeader) wrapper cloud.google.com/go/storage uses internally; only
+// call it for idempotent operations (e.g. CreateTask, Datastore PutMulti).
+func runWithRetry(ctx context.Context, cfg retryConfig, fn func() error) error {
+	maxElapsed := cfg.MaxElapsedTime
+	if maxElapsed <= 0 {
+		maxElapsed = defaultMaxElapsedTime
+	}
+	deadline := time.Now().Add(maxElapsed)
+
+	backoff := initialBackoff
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if !isRetryableError(err) || time.Now().After(deadline) {
+			return err
+		}
+
+		sleep := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2+1)))
+		timer := time.NewTimer(sleep)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= backoffMultiplier
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// isRetryableError reports whether err is a transient gRPC or HTTP error
+// worth retrying: codes.Unavailable, codes.DeadlineExceeded, codes.Internal,
+// or HTTP 408/429/5xx.
+func isRetryableError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal:
+		return true
+	}
+
+	if apiErr, ok := err.(*googleapi.Error); ok {
+		switch apiErr.Code {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return apiErr.Code >= 500
+	}
+
+	return false
+}
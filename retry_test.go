@@ -0,0 +1,42 @@
+package celbuxhelpers
+
+import (
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"grpc unavailable", status.Error(codes.Unavailable, "down"), true},
+		{"grpc deadline exceeded", status.Error(codes.DeadlineExceeded, "timeout"), true},
+		{"grpc internal", status.Error(codes.Internal, "oops"), true},
+		{"grpc not found", status.Error(codes.NotFound, "nope"), false},
+		{"http 429", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"http 408", &googleapi.Error{Code: http.StatusRequestTimeout}, true},
+		{"http 503", &googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+		{"http 500", &googleapi.Error{Code: http.StatusInternalServerError}, true},
+		{"http 400", &googleapi.Error{Code: http.StatusBadRequest}, false},
+		{"plain error", fakeErr{}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isRetryableError(c.err); got != c.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", c.err, got, c.want)
+			}
+		})
+	}
+}
+
+type fakeErr struct{}
+
+func (fakeErr) Error() string { return "fake" }
@@ -0,0 +1,213 @@
+package celbuxhelpers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+// DownloadOption configures DownloadObjectStream.
+type DownloadOption func(*downloadOptions)
+
+type downloadOptions struct {
+	offset, length int64
+	generation     int64
+	hasGeneration  bool
+	ifGenMatch     int64
+	hasIfGenMatch  bool
+}
+
+// WithRange restricts DownloadObjectStream to the byte range starting at
+// offset and spanning length bytes. A negative length reads to the end of
+// the object, matching storage.ObjectHandle.NewRangeReader.
+func WithRange(offset, length int64) DownloadOption {
+	return func(o *downloadOptions) {
+		o.offset, o.length = offset, length
+	}
+}
+
+// WithGeneration pins DownloadObjectStream to a specific object generation
+// instead of the live one.
+func WithGeneration(gen int64) DownloadOption {
+	return func(o *downloadOptions) {
+		o.generation, o.hasGeneration = gen, true
+	}
+}
+
+// WithIfGenerationMatch only downloads the object if its current generation
+// matches gen.
+func WithIfGenerationMatch(gen int64) DownloadOption {
+	return func(o *downloadOptions) {
+		o.ifGenMatch, o.hasIfGenMatch = gen, true
+	}
+}
+
+// DownloadObjectStream streams an object from Cloud Storage into w, copying
+// it in chunks instead of buffering the whole object in memory. storage.Reader
+// already retries transient stalls internally, so no additional retry wrapper
+// is applied here; see runWithRetry for the idempotent GCP calls that need
+// one. It returns the number of bytes written to w.
+//
+// NewRangeReader itself doesn't always notice ctx cancellation until the
+// first byte arrives, so opening it is bound to a Deadline seeded from ctx's
+// deadline and raced against it in a goroutine.
+func DownloadObjectStream(ctx context.Context, bucket, object string, w io.Writer, opts ...DownloadOption) (int64, error) {
+	var o downloadOptions
+	o.length = -1
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	handle := StorageClient.Bucket(bucket).Object(object)
+	if o.hasGeneration {
+		handle = handle.Generation(o.generation)
+	}
+	if o.hasIfGenMatch {
+		handle = handle.If(storage.Conditions{GenerationMatch: o.ifGenMatch})
+	}
+
+	deadline := NewDeadline()
+	if dl, ok := ctx.Deadline(); ok {
+		deadline.SetReadDeadline(dl)
+	}
+
+	type readerResult struct {
+		rc  *storage.Reader
+		err error
+	}
+	resultCh := make(chan readerResult, 1)
+	go func() {
+		rc, err := handle.NewRangeReader(ctx, o.offset, o.length)
+		resultCh <- readerResult{rc, err}
+	}()
+
+	var rc *storage.Reader
+	select {
+	case <-deadline.ReadCancel():
+		// NewRangeReader is still running in the background and may yet hand
+		// back an open reader; drain it on its own goroutine so that reader
+		// (and the HTTP connection it holds) gets closed instead of leaked.
+		go func() {
+			if res := <-resultCh; res.err == nil {
+				res.rc.Close()
+			}
+		}()
+		return 0, ctx.Err()
+	case res := <-resultCh:
+		if res.err != nil {
+			return 0, fmt.Errorf("Object(%q).NewRangeReader: %v", object, res.err)
+		}
+		rc = res.rc
+	}
+	defer rc.Close()
+
+	written, err := io.Copy(w, rc)
+	if err != nil {
+		return written, fmt.Errorf("io.Copy: %v", err)
+	}
+
+	return written, nil
+}
+
+// DownloadObject downloads an object from Cloud Storage in full.
+func DownloadObject(ctx context.Context, bucket string, object string) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := DownloadObjectStream(ctx, bucket, object, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UploadOption configures UploadObjectStream.
+type UploadOption func(*uploadOptions)
+
+type uploadOptions struct {
+	contentType   string
+	cacheControl  string
+	metadata      map[string]string
+	chunkSize     int
+	hasChunkSize  bool
+	ifGenMatch    int64
+	hasIfGenMatch bool
+}
+
+// WithContentType sets the uploaded object's Content-Type header.
+func WithContentType(contentType string) UploadOption {
+	return func(o *uploadOptions) {
+		o.contentType = contentType
+	}
+}
+
+// WithCacheControl sets the uploaded object's Cache-Control header.
+func WithCacheControl(cacheControl string) UploadOption {
+	return func(o *uploadOptions) {
+		o.cacheControl = cacheControl
+	}
+}
+
+// WithMetadata sets the uploaded object's custom metadata.
+func WithMetadata(metadata map[string]string) UploadOption {
+	return func(o *uploadOptions) {
+		o.metadata = metadata
+	}
+}
+
+// WithChunkSize overrides the Writer's resumable-upload chunk size. See
+// storage.Writer.ChunkSize for the tradeoffs of a zero value.
+func WithChunkSize(chunkSize int) UploadOption {
+	return func(o *uploadOptions) {
+		o.chunkSize, o.hasChunkSize = chunkSize, true
+	}
+}
+
+// WithUploadIfGenerationMatch only uploads if the object's current
+// generation matches gen. Pass 0 for create-only semantics, i.e. fail if the
+// object already exists. Named to match DownloadOption's
+// WithIfGenerationMatch; the Upload prefix is needed because Go doesn't
+// allow two top-level functions with the same name.
+func WithUploadIfGenerationMatch(gen int64) UploadOption {
+	return func(o *uploadOptions) {
+		o.ifGenMatch, o.hasIfGenMatch = gen, true
+	}
+}
+
+// UploadObjectStream uploads r to Cloud Storage as bucket/object, streaming
+// the body instead of buffering it in memory. storage.Writer already retries
+// individual chunk uploads internally, so no additional retry wrapper is
+// applied here; see runWithRetry for the idempotent GCP calls that need one.
+// It returns the attributes of the finished object.
+func UploadObjectStream(ctx context.Context, bucket, object string, r io.Reader, opts ...UploadOption) (*storage.ObjectAttrs, error) {
+	var o uploadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	handle := StorageClient.Bucket(bucket).Object(object)
+	if o.hasIfGenMatch {
+		if o.ifGenMatch == 0 {
+			handle = handle.If(storage.Conditions{DoesNotExist: true})
+		} else {
+			handle = handle.If(storage.Conditions{GenerationMatch: o.ifGenMatch})
+		}
+	}
+
+	w := handle.NewWriter(ctx)
+	w.ContentType = o.contentType
+	w.CacheControl = o.cacheControl
+	w.Metadata = o.metadata
+	if o.hasChunkSize {
+		w.ChunkSize = o.chunkSize
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, fmt.Errorf("io.Copy: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("Writer.Close: %v", err)
+	}
+
+	return w.Attrs(), nil
+}
@@ -1,8 +1,10 @@
 package celbuxhelpers
 
 import (
+	cloudtasks "cloud.google.com/go/cloudtasks/apiv2"
 	"cloud.google.com/go/datastore"
 	"cloud.google.com/go/errorreporting"
+	"cloud.google.com/go/logging"
 	"cloud.google.com/go/storage"
 )
 
@@ -16,4 +18,5 @@ var ErrorClient *errorreporting.Client
 var DatastoreClient *datastore.Client
 var StorageClient *storage.Client
 var LoggingClient *logging.Client
-var TasksClient *cloudtasks.Client
\ No newline at end of file
+var TasksClient *cloudtasks.Client
+var KMSEncryptionClient *EncryptionClient
\ No newline at end of file